@@ -0,0 +1,225 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+// setCombiner drives two sequenceCursors over the orderedSequences of a pair
+// of Sets in lock-step, emitting values into a sequenceChunker according to
+// the semantics of the particular set operation. All four operations below
+// share this same co-advancing cursor walk; they differ only in which side
+// (or both) they emit from when the cursors disagree, and in whether they
+// emit at all when the cursors agree.
+type setCombiner struct {
+	a, b      *sequenceCursor
+	ch        *sequenceChunker
+	closeChan <-chan struct{}
+}
+
+func newSetCombiner(a, b Set, ch *sequenceChunker, closeChan <-chan struct{}) setCombiner {
+	return setCombiner{
+		a:         newCursorAt(a.seq, emptyKey, false, false, false),
+		b:         newCursorAt(b.seq, emptyKey, false, false, false),
+		ch:        ch,
+		closeChan: closeChan,
+	}
+}
+
+// skipIdenticalSubtrees advances both |c| and |other| past an entire leaf in
+// one step when they are both positioned at the start of leaves whose chunk
+// refs are identical, so the values of a shared leaf are not compared one by
+// one. The cursors still step through every leaf of both Sets.
+func skipIdenticalSubtrees(c, other *sequenceCursor) bool {
+	if c.parent == nil || other.parent == nil {
+		return false
+	}
+	if c.parent.current() == nil || other.parent.current() == nil {
+		return false
+	}
+	cRef, cok := c.parent.current().(metaTuple)
+	oRef, ook := other.parent.current().(metaTuple)
+	if !cok || !ook || c.idx != 0 || other.idx != 0 {
+		return false
+	}
+	if cRef.ref != oRef.ref {
+		return false
+	}
+	c.idx = c.seq.seqLen() - 1
+	c.advance()
+	other.idx = other.seq.seqLen() - 1
+	other.advance()
+	return true
+}
+
+// run co-advances |a| and |b| in Noms sort order, calling |emitA| whenever
+// |a| holds a value not present in |b|, |emitB| whenever |b| holds a value
+// not present in |a|, and |emitBoth| whenever the two cursors agree on a
+// value, including each value of a leaf skipped by skipIdenticalSubtrees.
+// Any of the three callbacks may be nil, meaning "skip". The walk
+// respects |closeChan| for early cancellation, matching Diff.
+func (sc setCombiner) run(emitA, emitB func(v Value), emitBoth func(a, b Value)) {
+	for sc.a.valid() && sc.b.valid() {
+		select {
+		case <-sc.closeChan:
+			return
+		default:
+		}
+
+		if leaf := sc.a.seq; skipIdenticalSubtrees(sc.a, sc.b) {
+			if emitBoth != nil {
+				for i := 0; i < leaf.seqLen(); i++ {
+					v := leaf.getItem(i).(Value)
+					emitBoth(v, v)
+				}
+			}
+			continue
+		}
+
+		av := sc.a.current().(Value)
+		bv := sc.b.current().(Value)
+
+		switch {
+		case av.Less(bv):
+			if emitA != nil {
+				emitA(av)
+			}
+			sc.a.advance()
+		case bv.Less(av):
+			if emitB != nil {
+				emitB(bv)
+			}
+			sc.b.advance()
+		default:
+			if emitBoth != nil {
+				emitBoth(av, bv)
+			}
+			sc.a.advance()
+			sc.b.advance()
+		}
+	}
+
+	if emitA != nil {
+		for sc.a.valid() {
+			select {
+			case <-sc.closeChan:
+				return
+			default:
+			}
+			emitA(sc.a.current().(Value))
+			sc.a.advance()
+		}
+	}
+
+	if emitB != nil {
+		for sc.b.valid() {
+			select {
+			case <-sc.closeChan:
+				return
+			default:
+			}
+			emitB(sc.b.current().(Value))
+			sc.b.advance()
+		}
+	}
+}
+
+// Union returns a new Set containing every value present in |s| or |other|
+// (or both). The underlying orderedSequences are co-walked rather than
+// materialized into a SetEditor. Leaves the two Sets share are matched by
+// chunk ref instead of value by value, but their values are still appended
+// to the chunker one at a time, so the work grows with the size of the
+// result, not only with the size of the diff.
+func (s Set) Union(other Set, closeChan <-chan struct{}) Set {
+	ch := newEmptySetSequenceChunker(nil, nil)
+	sc := newSetCombiner(s, other, ch, closeChan)
+	sc.run(
+		func(v Value) { ch.Append(v) },
+		func(v Value) { ch.Append(v) },
+		func(a, b Value) { ch.Append(a) },
+	)
+	return newSet(ch.Done().(orderedSequence))
+}
+
+// Intersection returns a new Set containing only the values present in both
+// |s| and |other|.
+func (s Set) Intersection(other Set, closeChan <-chan struct{}) Set {
+	ch := newEmptySetSequenceChunker(nil, nil)
+	sc := newSetCombiner(s, other, ch, closeChan)
+	sc.run(nil, nil, func(a, b Value) { ch.Append(a) })
+	return newSet(ch.Done().(orderedSequence))
+}
+
+// Difference returns a new Set containing the values present in |s| but not
+// in |other|.
+func (s Set) Difference(other Set, closeChan <-chan struct{}) Set {
+	ch := newEmptySetSequenceChunker(nil, nil)
+	sc := newSetCombiner(s, other, ch, closeChan)
+	sc.run(func(v Value) { ch.Append(v) }, nil, nil)
+	return newSet(ch.Done().(orderedSequence))
+}
+
+// SymmetricDifference returns a new Set containing the values present in
+// exactly one of |s| and |other|.
+func (s Set) SymmetricDifference(other Set, closeChan <-chan struct{}) Set {
+	ch := newEmptySetSequenceChunker(nil, nil)
+	sc := newSetCombiner(s, other, ch, closeChan)
+	sc.run(
+		func(v Value) { ch.Append(v) },
+		func(v Value) { ch.Append(v) },
+		nil,
+	)
+	return newSet(ch.Done().(orderedSequence))
+}
+
+// UnionSets returns the Union of all of |sets|, combining them pairwise.
+// Passing zero Sets returns an empty Set.
+func UnionSets(closeChan <-chan struct{}, sets ...Set) Set {
+	if len(sets) == 0 {
+		return NewSet()
+	}
+	acc := sets[0]
+	for _, s := range sets[1:] {
+		acc = acc.Union(s, closeChan)
+	}
+	return acc
+}
+
+// IntersectSets returns the Intersection of all of |sets|, combining them
+// pairwise. Passing zero Sets returns an empty Set.
+func IntersectSets(closeChan <-chan struct{}, sets ...Set) Set {
+	if len(sets) == 0 {
+		return NewSet()
+	}
+	acc := sets[0]
+	for _, s := range sets[1:] {
+		acc = acc.Intersection(s, closeChan)
+	}
+	return acc
+}
+
+// DifferenceSets returns the Set of values in |sets[0]| that are not present
+// in any of |sets[1:]|. Passing zero Sets returns an empty Set.
+func DifferenceSets(closeChan <-chan struct{}, sets ...Set) Set {
+	if len(sets) == 0 {
+		return NewSet()
+	}
+	acc := sets[0]
+	for _, s := range sets[1:] {
+		acc = acc.Difference(s, closeChan)
+	}
+	return acc
+}
+
+// SymmetricDifferenceSets returns the Set of values present in an odd number
+// of |sets|, combining them pairwise. Passing zero Sets returns an empty
+// Set.
+func SymmetricDifferenceSets(closeChan <-chan struct{}, sets ...Set) Set {
+	if len(sets) == 0 {
+		return NewSet()
+	}
+	acc := sets[0]
+	for _, s := range sets[1:] {
+		acc = acc.SymmetricDifference(s, closeChan)
+	}
+	return acc
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import "testing"
+
+// setOfNumbers builds a Set containing Number(n) for each n in [from, to),
+// which is large enough (given the default chunking parameters) to span
+// several leaf chunks and at least one level of meta-sequence, so tests
+// built on it exercise the skipIdenticalSubtrees fast path rather than just
+// the single-leaf case.
+func setOfNumbers(from, to int) Set {
+	vals := make(ValueSlice, 0, to-from)
+	for i := from; i < to; i++ {
+		vals = append(vals, Number(i))
+	}
+	return NewSet(vals...)
+}
+
+func assertSetEqualsRange(t *testing.T, s Set, from, to int) {
+	t.Helper()
+	if s.Len() != uint64(to-from) {
+		t.Fatalf("expected %d members, got %d", to-from, s.Len())
+	}
+	for i := from; i < to; i++ {
+		if !s.Has(Number(i)) {
+			t.Fatalf("expected set to contain %d", i)
+		}
+	}
+}
+
+func TestSetUnionMultiChunk(t *testing.T) {
+	a := setOfNumbers(0, 5000)
+	b := setOfNumbers(4000, 9000)
+	u := a.Union(b, nil)
+	assertSetEqualsRange(t, u, 0, 9000)
+}
+
+func TestSetIntersectionMultiChunk(t *testing.T) {
+	a := setOfNumbers(0, 5000)
+	b := setOfNumbers(4000, 9000)
+	i := a.Intersection(b, nil)
+	assertSetEqualsRange(t, i, 4000, 5000)
+}
+
+func TestSetDifferenceMultiChunk(t *testing.T) {
+	a := setOfNumbers(0, 5000)
+	b := setOfNumbers(4000, 9000)
+	d := a.Difference(b, nil)
+	assertSetEqualsRange(t, d, 0, 4000)
+}
+
+func TestSetSymmetricDifferenceMultiChunk(t *testing.T) {
+	a := setOfNumbers(0, 5000)
+	b := setOfNumbers(4000, 9000)
+	sd := a.SymmetricDifference(b, nil)
+	if sd.Len() != 4000+4000 {
+		t.Fatalf("expected 8000 members, got %d", sd.Len())
+	}
+	for i := 0; i < 4000; i++ {
+		if !sd.Has(Number(i)) {
+			t.Fatalf("expected symmetric difference to contain %d", i)
+		}
+	}
+	for i := 5000; i < 9000; i++ {
+		if !sd.Has(Number(i)) {
+			t.Fatalf("expected symmetric difference to contain %d", i)
+		}
+	}
+}
+
+func TestSetUnionIdenticalMultiChunk(t *testing.T) {
+	a := setOfNumbers(0, 9000)
+	b := setOfNumbers(0, 9000)
+	u := a.Union(b, nil)
+	assertSetEqualsRange(t, u, 0, 9000)
+}
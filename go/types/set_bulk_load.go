@@ -0,0 +1,234 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"container/heap"
+
+	"github.com/attic-labs/noms/go/d"
+)
+
+// BulkLoadOptions controls the resource usage of NewStreamingSetUnordered.
+type BulkLoadOptions struct {
+	// RunSize is the number of values buffered in memory before being
+	// sorted, deduped, and flushed as a temporary run. Defaults to 100,000
+	// if zero.
+	RunSize int
+
+	// MaxOpenRuns caps how many run roots are merged at once. If more runs
+	// are produced than this, they are cascade-merged in batches rather
+	// than all being opened simultaneously. Defaults to 32 if zero.
+	MaxOpenRuns int
+
+	// Progress, if non-nil, receives a BulkLoadStats update after each run
+	// is flushed and once more when the final merge completes. Sends are
+	// non-blocking; a full channel simply misses an update.
+	Progress chan<- BulkLoadStats
+}
+
+// BulkLoadStats reports the progress of a NewStreamingSetUnordered call.
+type BulkLoadStats struct {
+	// ValuesSeen is the number of values read from the input channel so far.
+	ValuesSeen uint64
+	// RunsFlushed is the number of sorted runs written so far.
+	RunsFlushed uint64
+	// RunsMerged is the number of those flushed runs whose values have been
+	// folded into a merge (a cascade or the final one) so far. A run
+	// produced by an earlier cascade is itself just bookkeeping, not a
+	// second original run, so merging it back in during a later cascade
+	// does not add to this count again; RunsMerged reaches RunsFlushed
+	// exactly once every original run has been incorporated.
+	RunsMerged uint64
+}
+
+func (o BulkLoadOptions) withDefaults() BulkLoadOptions {
+	if o.RunSize <= 0 {
+		o.RunSize = 100000
+	}
+	if o.MaxOpenRuns <= 0 {
+		o.MaxOpenRuns = 32
+	}
+	return o
+}
+
+func (o BulkLoadOptions) reportProgress(stats BulkLoadStats) {
+	if o.Progress == nil {
+		return
+	}
+	select {
+	case o.Progress <- stats:
+	default:
+	}
+}
+
+// NewStreamingSetUnordered is the out-of-order counterpart to
+// NewStreamingSet: it accepts values on |vals| in any order and streams a
+// finished Set to the returned channel once |vals| is closed, without ever
+// holding the whole input in memory. Values are buffered in runs of up to
+// opts.RunSize, each run is sorted and deduped in memory and flushed to a
+// temporary leaf-only Set via |vrw| (retaining only its root Ref), and once
+// all runs are flushed they are k-way merged by a min-heap of
+// sequenceCursors feeding the same leaf/meta chunker NewSet uses, so the
+// result is an ordinary prolly tree indistinguishable from one built with
+// NewSet. If more than opts.MaxOpenRuns runs are produced, they are merged
+// down in cascades to keep the heap fanout bounded.
+func NewStreamingSetUnordered(vrw ValueReadWriter, vals <-chan Value, opts BulkLoadOptions) <-chan Set {
+	opts = opts.withDefaults()
+	outChan := make(chan Set, 1)
+
+	go func() {
+		defer close(outChan)
+
+		var stats BulkLoadStats
+		var runs []pendingRun
+		buf := make(ValueSlice, 0, opts.RunSize)
+
+		flush := func() {
+			if len(buf) == 0 {
+				return
+			}
+			data := buildSetData(buf)
+			run := newSet(newSetLeafSequence(vrw, data...))
+			ref := vrw.WriteValue(run)
+			runs = append(runs, pendingRun{ref: ref})
+			buf = make(ValueSlice, 0, opts.RunSize)
+
+			stats.RunsFlushed++
+			opts.reportProgress(stats)
+
+			runs = cascadeMergeRuns(vrw, runs, opts, &stats)
+		}
+
+		for v := range vals {
+			d.PanicIfTrue(v == nil)
+			buf = append(buf, v)
+			stats.ValuesSeen++
+			if len(buf) >= opts.RunSize {
+				flush()
+			}
+		}
+		flush()
+
+		if len(runs) == 0 {
+			outChan <- NewSet()
+			return
+		}
+
+		runs = cascadeMergeRuns(vrw, runs, opts, &stats)
+		final := mergeRuns(vrw, pendingRefs(runs))
+		countNewlyMerged(&stats, runs)
+		opts.reportProgress(stats)
+		outChan <- final
+	}()
+
+	return outChan
+}
+
+// pendingRun is one entry in the queue of not-yet-fully-merged runs: either a
+// leaf-only Set freshly flushed from the input (counted == false) or the
+// output of an earlier cascade merge, whose constituent original runs have
+// already been reported via BulkLoadStats.RunsMerged (counted == true).
+type pendingRun struct {
+	ref     Ref
+	counted bool
+}
+
+func pendingRefs(runs []pendingRun) []Ref {
+	refs := make([]Ref, len(runs))
+	for i, r := range runs {
+		refs[i] = r.ref
+	}
+	return refs
+}
+
+// countNewlyMerged reports the runs in |runs| that haven't been counted
+// toward BulkLoadStats.RunsMerged yet -- i.e. the original flushed runs, as
+// opposed to the output of an earlier cascade -- as merged.
+func countNewlyMerged(stats *BulkLoadStats, runs []pendingRun) {
+	for _, r := range runs {
+		if !r.counted {
+			stats.RunsMerged++
+		}
+	}
+}
+
+// runHeapItem is one entry in the k-way merge heap: a cursor positioned over
+// one run's leaf data, kept live by the Ref of that run's root Value.
+type runHeapItem struct {
+	cur *sequenceCursor
+}
+
+type runHeap []runHeapItem
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	return h[i].cur.current().(Value).Less(h[j].cur.current().(Value))
+}
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(runHeapItem)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// mergeRuns k-way merges the Sets referenced by |runs| (leaf-only flushed
+// runs or the chunked output of an earlier cascade) into a single Set, deduplicating equal values across runs. It does not update
+// BulkLoadStats.RunsMerged itself: some of |runs| may be the output of an
+// earlier cascade rather than an original flushed run, and only the caller
+// knows which is which (see countNewlyMerged).
+func mergeRuns(vrw ValueReadWriter, runs []Ref) Set {
+	ch := newEmptySetSequenceChunker(vrw, vrw)
+
+	h := &runHeap{}
+	heap.Init(h)
+	for _, ref := range runs {
+		run := ref.TargetValue(vrw).(Set)
+		cur := newCursorAt(run.seq, emptyKey, false, false, false)
+		if cur.valid() {
+			heap.Push(h, runHeapItem{cur})
+		}
+	}
+
+	var last Value
+	for h.Len() > 0 {
+		item := heap.Pop(h).(runHeapItem)
+		v := item.cur.current().(Value)
+		if last == nil || !last.Equals(v) {
+			ch.Append(v)
+			last = v
+		}
+		if item.cur.advance() {
+			heap.Push(h, item)
+		}
+	}
+
+	return newSet(ch.Done().(orderedSequence))
+}
+
+// cascadeMergeRuns keeps the number of open runs bounded by opts.MaxOpenRuns
+// without ever re-scanning data that's already been merged: while |runs|
+// holds more than opts.MaxOpenRuns entries, it merges only the oldest batch
+// of opts.MaxOpenRuns runs into one new run and moves that run to the back
+// of the queue, leaving every other run untouched. Each run therefore
+// participates in O(log_MaxOpenRuns(total runs)) merges over the life of the
+// load, rather than being re-merged on every cascade. The runs folded into
+// that batch are reported via BulkLoadStats.RunsMerged, but only the ones
+// that hadn't been counted by an earlier cascade yet -- the new run that
+// replaces the batch carries the rest forward already counted, so a run
+// that passes through several cascades is never double-counted.
+func cascadeMergeRuns(vrw ValueReadWriter, runs []pendingRun, opts BulkLoadOptions, stats *BulkLoadStats) []pendingRun {
+	for len(runs) > opts.MaxOpenRuns {
+		batch := runs[:opts.MaxOpenRuns]
+		rest := runs[opts.MaxOpenRuns:]
+		merged := mergeRuns(vrw, pendingRefs(batch))
+		countNewlyMerged(stats, batch)
+		ref := vrw.WriteValue(merged)
+		runs = append(append([]pendingRun{}, rest...), pendingRun{ref: ref, counted: true})
+	}
+	return runs
+}
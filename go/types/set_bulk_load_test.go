@@ -0,0 +1,84 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/attic-labs/noms/go/chunks"
+)
+
+func newTestValueStore() *ValueStore {
+	return NewValueStore(chunks.NewTestStore())
+}
+
+// TestNewStreamingSetUnorderedExceedsMaxOpenRuns feeds enough out-of-order
+// values, with a small RunSize and MaxOpenRuns, to force multiple cascades
+// -- the case where a naive "re-merge everything" cascade degrades to
+// O(n^2/RunSize) work and where a previous cascade's output could otherwise
+// be folded back in and re-scanned by the next one.
+func TestNewStreamingSetUnorderedExceedsMaxOpenRuns(t *testing.T) {
+	const n = 5000
+	perm := rand.New(rand.NewSource(1)).Perm(n)
+
+	vals := make(chan Value)
+	go func() {
+		defer close(vals)
+		for _, i := range perm {
+			vals <- Number(i)
+		}
+	}()
+
+	vs := newTestValueStore()
+	defer vs.Close()
+
+	outChan := NewStreamingSetUnordered(vs, vals, BulkLoadOptions{RunSize: 50, MaxOpenRuns: 4})
+	s := <-outChan
+
+	if s.Len() != uint64(n) {
+		t.Fatalf("expected %d members, got %d", n, s.Len())
+	}
+	for i := 0; i < n; i++ {
+		if !s.Has(Number(i)) {
+			t.Fatalf("expected set to contain %d", i)
+		}
+	}
+}
+
+func TestNewStreamingSetUnorderedDedup(t *testing.T) {
+	vals := make(chan Value)
+	go func() {
+		defer close(vals)
+		for i := 0; i < 3; i++ {
+			vals <- Number(1)
+			vals <- Number(2)
+			vals <- Number(3)
+		}
+	}()
+
+	vs := newTestValueStore()
+	defer vs.Close()
+
+	outChan := NewStreamingSetUnordered(vs, vals, BulkLoadOptions{RunSize: 2, MaxOpenRuns: 2})
+	s := <-outChan
+	if s.Len() != 3 {
+		t.Fatalf("expected 3 deduped members, got %d", s.Len())
+	}
+}
+
+func TestNewStreamingSetUnorderedEmpty(t *testing.T) {
+	vals := make(chan Value)
+	close(vals)
+
+	vs := newTestValueStore()
+	defer vs.Close()
+
+	outChan := NewStreamingSetUnordered(vs, vals, BulkLoadOptions{})
+	s := <-outChan
+	if !s.Empty() {
+		t.Fatalf("expected empty set, got %d members", s.Len())
+	}
+}
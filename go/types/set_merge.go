@@ -0,0 +1,153 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import "github.com/attic-labs/noms/go/hash"
+
+// ThreeWayMerge merges the changes made from |base| to |a| and from |base|
+// to |b| into a single Set. It drives two simultaneous top-down diffs,
+// base->a and base->b, recording each change by the hash of the value it
+// touches so that a change applied independently to the same value on both
+// sides (both sides add it, or both sides remove it) is applied once rather
+// than being treated as a conflict.
+//
+// |conflicts| is always empty for a Set. In a content-addressed Set a
+// member's hash *is* its identity, so there is no notion of "the same
+// logical member, changed two different ways" the way there is for a Map
+// key: retargeting a Ref member (e.g. to point at a new version of a
+// mutable value) produces a Remove of the old Ref's hash and an Add of the
+// new Ref's hash, two unrelated hashes with no shared key linking them.
+// Detecting that kind of "concurrent retarget" conflict would require an
+// identity scheme external to the Set (e.g. a Map from a stable ID to a
+// Ref), which is outside what ThreeWayMerge can infer from the Set alone.
+// |conflicts| is accepted for symmetry with other ThreeWayMerge-style APIs
+// and to leave room for such a scheme later, but nothing is ever sent on
+// it today.
+//
+// The result is deterministic and does not depend on which side is labeled
+// |a| vs |b|.
+func ThreeWayMerge(base, a, b Set, changes chan<- ValueChanged, conflicts chan<- Value, closeChan <-chan struct{}) Set {
+	aChanges := make(chan ValueChanged)
+	bChanges := make(chan ValueChanged)
+
+	go func() {
+		defer close(aChanges)
+		orderedSequenceDiffTopDown(base.seq, a.seq, aChanges, closeChan)
+	}()
+	go func() {
+		defer close(bChanges)
+		orderedSequenceDiffTopDown(base.seq, b.seq, bChanges, closeChan)
+	}()
+
+	aByKey := map[hash.Hash]ValueChanged{}
+	for c := range aChanges {
+		aByKey[c.V.Hash()] = c
+	}
+	bByKey := map[hash.Hash]ValueChanged{}
+	for c := range bChanges {
+		bByKey[c.V.Hash()] = c
+	}
+
+	select {
+	case <-closeChan:
+		// Either diff may have stopped early because of this; the maps
+		// above are then incomplete and it would be wrong to treat them as
+		// the full set of changes.
+		return Set{}
+	default:
+	}
+
+	result := make(ValueSlice, 0, base.Len())
+	var added ValueSlice
+	cur := newCursorAt(base.seq, emptyKey, false, false, false)
+
+	seen := map[hash.Hash]bool{}
+
+	// resolve marks |c|'s key as handled and reports the outcome: the net
+	// value to keep in the result (if any) plus whether that value is a net
+	// new addition that needs to be reported on |changes|.
+	resolve := func(c ValueChanged) (v Value, keep bool) {
+		seen[c.V.Hash()] = true
+		if c.ChangeType == DiffChangeAdded {
+			return c.V, true
+		}
+		return nil, false
+	}
+
+	for cur.valid() {
+		v := cur.current().(Value)
+		h := v.Hash()
+		ac, aChanged := aByKey[h]
+		bc, bChanged := bByKey[h]
+
+		switch {
+		case !aChanged && !bChanged:
+			result = append(result, v)
+		case aChanged && !bChanged:
+			if nv, keep := resolve(ac); keep {
+				result = append(result, nv)
+				added = append(added, nv)
+			}
+		case !aChanged && bChanged:
+			if nv, keep := resolve(bc); keep {
+				result = append(result, nv)
+				added = append(added, nv)
+			}
+		default:
+			// Both sides recorded a change keyed by the same hash. Since the
+			// key is the value's own hash, both changes necessarily concern
+			// the exact same Value; they can only disagree if one side
+			// added it while the other removed it, which is impossible --
+			// a value can't simultaneously have been present in |base|
+			// (required for a Remove) and absent from |base| (required for
+			// an Add). So ac and bc always agree, and applying either is
+			// correct and conflict-free.
+			if nv, keep := resolve(ac); keep {
+				result = append(result, nv)
+				added = append(added, nv)
+			}
+			resolve(bc)
+		}
+		cur.advance()
+	}
+
+	for h, ac := range aByKey {
+		if seen[h] {
+			continue
+		}
+		if nv, keep := resolve(ac); keep {
+			result = append(result, nv)
+			added = append(added, nv)
+		}
+	}
+	for h, bc := range bByKey {
+		if seen[h] {
+			continue
+		}
+		if nv, keep := resolve(bc); keep {
+			result = append(result, nv)
+			added = append(added, nv)
+		}
+	}
+
+	// Members removed from |base| were never appended above, and members
+	// added fresh by either side were appended in no particular order (base
+	// order for the first loop, map iteration order for the two stragglers
+	// above), so the leaf chunker -- which panics on out-of-order input --
+	// needs this sorted and deduped first, the same way NewSet does.
+	data := buildSetData(result)
+	ch := newEmptySetSequenceChunker(nil, nil)
+	for _, v := range data {
+		ch.Append(v)
+	}
+
+	if changes != nil {
+		for _, v := range added {
+			changes <- ValueChanged{ChangeType: DiffChangeAdded, V: v}
+		}
+	}
+
+	return newSet(ch.Done().(orderedSequence))
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import "testing"
+
+// TestThreeWayMergeAdditionHeavy exercises the case the maintainer flagged:
+// a merge where additions don't sort after everything already in base, which
+// used to panic in the leaf chunker because the straggler-append loop fed it
+// out-of-order data.
+func TestThreeWayMergeAdditionHeavy(t *testing.T) {
+	base := NewSet(Number(1), Number(5), Number(10))
+	a := NewSet(Number(1), Number(3), Number(5), Number(10))
+	b := NewSet(Number(1), Number(5), Number(7), Number(10))
+
+	merged := ThreeWayMerge(base, a, b, nil, nil, nil)
+
+	want := []Number{1, 3, 5, 7, 10}
+	if merged.Len() != uint64(len(want)) {
+		t.Fatalf("expected %d members, got %d", len(want), merged.Len())
+	}
+	for _, n := range want {
+		if !merged.Has(n) {
+			t.Fatalf("expected merged set to contain %v", n)
+		}
+	}
+}
+
+func TestThreeWayMergeRemoval(t *testing.T) {
+	base := NewSet(Number(1), Number(2), Number(3))
+	a := NewSet(Number(1), Number(3))
+	b := NewSet(Number(1), Number(2), Number(3))
+
+	merged := ThreeWayMerge(base, a, b, nil, nil, nil)
+	if merged.Len() != 2 || !merged.Has(Number(1)) || !merged.Has(Number(3)) {
+		t.Fatalf("expected {1, 3}, got a set of len %d", merged.Len())
+	}
+}
+
+func TestThreeWayMergeSymmetric(t *testing.T) {
+	base := NewSet(Number(1), Number(5), Number(10))
+	a := NewSet(Number(1), Number(3), Number(5), Number(10))
+	b := NewSet(Number(1), Number(5), Number(7), Number(10))
+
+	ab := ThreeWayMerge(base, a, b, nil, nil, nil)
+	ba := ThreeWayMerge(base, b, a, nil, nil, nil)
+	if ab.Hash() != ba.Hash() {
+		t.Fatalf("expected merge to be independent of argument order")
+	}
+}
+
+func TestThreeWayMergeNoConflictsChannel(t *testing.T) {
+	base := NewSet(Number(1), Number(2))
+	a := NewSet(Number(1), Number(2), Number(3))
+	b := NewSet(Number(1), Number(2), Number(4))
+
+	conflicts := make(chan Value, 8)
+	merged := ThreeWayMerge(base, a, b, nil, conflicts, nil)
+	close(conflicts)
+
+	for range conflicts {
+		t.Fatalf("did not expect any conflicts from a Set merge")
+	}
+	if merged.Len() != 4 {
+		t.Fatalf("expected 4 members, got %d", merged.Len())
+	}
+}
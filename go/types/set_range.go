@@ -0,0 +1,270 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+// retreat steps |cur| one position backwards, recursing into the parent
+// cursor when it runs off the start of the current sequence, mirroring the
+// forward-stepping logic in advance. It returns whether the cursor landed on
+// a valid position.
+func (cur *sequenceCursor) retreat() bool {
+	if cur.idx > 0 {
+		cur.idx--
+		return true
+	}
+	if cur.idx == 0 && cur.parent != nil && cur.parent.retreat() {
+		cur.seq = cur.parent.current().(metaTuple).getChildSequence(nil)
+		cur.idx = int(cur.seq.seqLen()) - 1
+		return cur.idx >= 0
+	}
+	cur.idx = -1
+	return false
+}
+
+// IteratorRange returns a SetIterator that visits only the values |v| for
+// which |lo| <= |v| <= |hi|, honouring |loInclusive| and |hiInclusive| to
+// decide whether the endpoints themselves are included. Either bound may be
+// nil to mean "unbounded" on that side. The iterator stops cleanly once it
+// passes |hi|; callers do not need to check each returned value against the
+// bound themselves.
+func (s Set) IteratorRange(lo, hi Value, loInclusive, hiInclusive bool) SetIterator {
+	cur := rangeStartCursor(s.seq, lo, loInclusive)
+	return &setRangeIterator{
+		cursor:      cur,
+		hi:          hi,
+		hiInclusive: hiInclusive,
+	}
+}
+
+// IteratorRangeReverse is the reverse-order counterpart to IteratorRange: it
+// visits values from |hi| down to |lo|.
+func (s Set) IteratorRangeReverse(lo, hi Value, loInclusive, hiInclusive bool) SetIterator {
+	cur := rangeEndCursor(s.seq, hi, hiInclusive)
+	return &setRangeIterator{
+		cursor:      cur,
+		hi:          lo,
+		hiInclusive: loInclusive,
+		reverse:     true,
+	}
+}
+
+func rangeStartCursor(seq orderedSequence, lo Value, loInclusive bool) *sequenceCursor {
+	if lo == nil {
+		return newCursorAt(seq, emptyKey, false, false, false)
+	}
+	cur := newCursorAtValue(seq, lo, false, false, false)
+	if !loInclusive && cur.valid() && cur.current().(Value).Equals(lo) {
+		cur.advance()
+	}
+	return cur
+}
+
+func rangeEndCursor(seq orderedSequence, hi Value, hiInclusive bool) *sequenceCursor {
+	if hi == nil {
+		cur := newCursorAtIndex(seq, seq.numLeaves(), false)
+		cur.retreat()
+		return cur
+	}
+	cur := newCursorAtValue(seq, hi, false, false, false)
+	if cur.valid() && cur.current().(Value).Equals(hi) {
+		if !hiInclusive {
+			cur.retreat()
+		}
+	} else {
+		cur.retreat()
+	}
+	return cur
+}
+
+// setRangeIterator wraps a sequenceCursor, stopping once it steps past |hi|.
+// When |reverse| is set the cursor steps backward via sequenceCursor.retreat
+// instead of forward and |hi| holds the lower bound, which the iterator stops
+// at once it steps below it; this serves IteratorRangeReverse.
+type setRangeIterator struct {
+	cursor      *sequenceCursor
+	hi          Value
+	hiInclusive bool
+	reverse     bool
+	done        bool
+}
+
+func (sri *setRangeIterator) Next() Value {
+	if sri.done || !sri.cursor.valid() {
+		sri.done = true
+		return nil
+	}
+
+	v := sri.cursor.current().(Value)
+	if sri.hi != nil {
+		if v.Equals(sri.hi) {
+			if !sri.hiInclusive {
+				sri.done = true
+				return nil
+			}
+		} else if (!sri.reverse && sri.hi.Less(v)) || (sri.reverse && v.Less(sri.hi)) {
+			sri.done = true
+			return nil
+		}
+	}
+
+	if sri.reverse {
+		sri.cursor.retreat()
+	} else {
+		sri.cursor.advance()
+	}
+	return v
+}
+
+// CountRange returns the number of values |v| in |s| for which
+// |lo| <= |v| <= |hi|, either bound may be nil to mean unbounded. The count
+// never scans leaves that are fully covered by the range: it walks the
+// meta-sequence to find the first and last subtrees the range touches, sums
+// numLeaves() of every subtree strictly between them, and only descends into
+// the two boundary subtrees to count the partial leaves there.
+func (s Set) CountRange(lo, hi Value) uint64 {
+	return s.countRange(lo, hi, true)
+}
+
+// countRange is the shared implementation behind CountRange and
+// CountPrefix: |lo| is always inclusive, |hi| is inclusive iff
+// |hiInclusive|, either may be nil for unbounded.
+func (s Set) countRange(lo, hi Value, hiInclusive bool) uint64 {
+	seq, ok := s.seq.(metaSequence)
+	if !ok {
+		return countRangeInLeaf(s.seq, lo, hi, hiInclusive)
+	}
+	return countRangeMeta(seq, lo, hi, hiInclusive)
+}
+
+func countRangeInLeaf(seq orderedSequence, lo, hi Value, hiInclusive bool) uint64 {
+	var count uint64
+	cur := rangeStartCursor(seq, lo, true)
+	for cur.valid() {
+		v := cur.current().(Value)
+		if hi != nil {
+			if v.Equals(hi) {
+				if !hiInclusive {
+					break
+				}
+			} else if hi.Less(v) {
+				break
+			}
+		}
+		count++
+		cur.advance()
+	}
+	return count
+}
+
+// countRangeMeta sums the leaf count of every child subtree that is fully
+// covered by [lo, hi] straight from its metaTuple, without descending into
+// it, and only recurses into the (at most two) boundary subtrees the range
+// partially overlaps. |lo|/|hi| nil means unbounded on that side.
+func countRangeMeta(seq metaSequence, lo, hi Value, hiInclusive bool) uint64 {
+	var count uint64
+	var loKey, hiKey orderedKey
+	if lo != nil {
+		loKey = newOrderedKey(lo)
+	}
+	if hi != nil {
+		hiKey = newOrderedKey(hi)
+	}
+
+	// prevMax is only meaningful once havePrev is set; the first child has no
+	// previous sibling and so no lower bound on its values.
+	var prevMax orderedKey
+	havePrev := false
+	for i := 0; i < seq.seqLen(); i++ {
+		mt := seq.getItem(i).(metaTuple)
+
+		// prevMax is the max key of the previous sibling, so every value in
+		// this child is strictly greater than it; if we've already reached
+		// or passed hi there, every remaining child (including this one) is
+		// entirely above the range and we're done.
+		if hi != nil && havePrev && !prevMax.Less(hiKey) {
+			break
+		}
+
+		if lo != nil && mt.value.Less(loKey) {
+			// Every value in this child is <= mt.value < lo: entirely below
+			// the range, skip without descending.
+			prevMax = mt.value
+			havePrev = true
+			continue
+		}
+
+		lowOK := lo == nil || (havePrev && !prevMax.Less(loKey))
+		highOK := hi == nil || (hiInclusive && !hiKey.Less(mt.value)) || (!hiInclusive && mt.value.Less(hiKey))
+
+		if lowOK && highOK {
+			count += mt.numLeaves
+		} else {
+			child := mt.getChildSequence(nil)
+			if childMeta, ok := child.(metaSequence); ok {
+				count += countRangeMeta(childMeta, lo, hi, hiInclusive)
+			} else {
+				count += countRangeInLeaf(child.(orderedSequence), lo, hi, hiInclusive)
+			}
+		}
+
+		prevMax = mt.value
+		havePrev = true
+	}
+	return count
+}
+
+// NthInRange returns the value at zero-based offset |n| within the range
+// |lo|..|hi| (inclusive of both bounds), or nil if |n| is out of bounds.
+func (s Set) NthInRange(lo, hi Value, n uint64) Value {
+	it := s.IteratorRange(lo, hi, true, true)
+	for i := uint64(0); i < n; i++ {
+		if it.Next() == nil {
+			return nil
+		}
+	}
+	return it.Next()
+}
+
+// CountPrefix returns the number of members of |s| whose natural ordering
+// places them in the contiguous range beginning with |prefix|. For String
+// members this is sub-linear: it reuses the same meta-sequence walk as
+// CountRange with an exclusive upper bound computed by prefixUpperBound, so
+// a member exactly equal to that sentinel (which itself does not begin with
+// |prefix|) is never counted.
+//
+// Every Ref carries a complete TargetHash rather than a variable-length
+// string, so there is no shorter Ref that represents "just a hash prefix":
+// for Ref, CountPrefix degenerates to an exact-match count (0 or 1) of
+// |prefix| itself, via the same sub-linear CountRange(prefix, prefix) used
+// for an exact-equality range.
+func (s Set) CountPrefix(prefix Value) uint64 {
+	if _, ok := prefix.(Ref); ok {
+		return s.CountRange(prefix, prefix)
+	}
+	hi := prefixUpperBound(prefix)
+	if _, ok := prefix.(String); !ok {
+		return s.countRange(prefix, hi, true)
+	}
+	return s.countRange(prefix, hi, false)
+}
+
+// prefixUpperBound returns a Value that sorts immediately after every Value
+// beginning with |prefix|, for use as the exclusive upper bound of a
+// CountPrefix/prefix-range query. For String it is the prefix with its last
+// byte incremented. Other kinds have no meaningful prefix relationship and
+// just fall back to |prefix| itself as an inclusive bound.
+func prefixUpperBound(prefix Value) Value {
+	s, ok := prefix.(String)
+	if !ok {
+		return prefix
+	}
+	bs := []byte(string(s))
+	for i := len(bs) - 1; i >= 0; i-- {
+		if bs[i] < 0xff {
+			bs[i]++
+			return String(bs[:i+1])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 Attic Labs, Inc. All rights reserved.
+// Licensed under the Apache License, version 2.0:
+// http://www.apache.org/licenses/LICENSE-2.0
+
+package types
+
+import "testing"
+
+func TestSetCountRangeMultiChunk(t *testing.T) {
+	s := setOfNumbers(0, 9000)
+
+	if got := s.CountRange(nil, nil); got != 9000 {
+		t.Fatalf("CountRange(nil, nil) = %d, want 9000", got)
+	}
+	if got := s.CountRange(Number(100), Number(199)); got != 100 {
+		t.Fatalf("CountRange(100, 199) = %d, want 100", got)
+	}
+	if got := s.CountRange(Number(8995), nil); got != 5 {
+		t.Fatalf("CountRange(8995, nil) = %d, want 5", got)
+	}
+	if got := s.CountRange(nil, Number(4)); got != 5 {
+		t.Fatalf("CountRange(nil, 4) = %d, want 5", got)
+	}
+	// A range that spans several chunk boundaries should agree with a
+	// brute-force scan.
+	want := 0
+	s.IterAll(func(v Value) {
+		n := v.(Number)
+		if n >= 3333 && n <= 6666 {
+			want++
+		}
+	})
+	if got := s.CountRange(Number(3333), Number(6666)); got != uint64(want) {
+		t.Fatalf("CountRange(3333, 6666) = %d, want %d", got, want)
+	}
+}
+
+func TestSetIteratorRange(t *testing.T) {
+	s := setOfNumbers(0, 9000)
+	it := s.IteratorRange(Number(100), Number(103), true, true)
+	for i := 100; i <= 103; i++ {
+		if v := it.Next(); v == nil || v.(Number) != Number(i) {
+			t.Fatalf("expected %d, got %v", i, v)
+		}
+	}
+	if v := it.Next(); v != nil {
+		t.Fatalf("expected iterator to stop at upper bound, got %v", v)
+	}
+
+	it = s.IteratorRange(Number(100), Number(103), false, false)
+	for i := 101; i <= 102; i++ {
+		if v := it.Next(); v == nil || v.(Number) != Number(i) {
+			t.Fatalf("expected %d, got %v", i, v)
+		}
+	}
+	if v := it.Next(); v != nil {
+		t.Fatalf("expected exclusive upper bound to stop iteration, got %v", v)
+	}
+}
+
+func TestSetIteratorRangeReverse(t *testing.T) {
+	s := setOfNumbers(0, 9000)
+	it := s.IteratorRangeReverse(Number(100), Number(103), true, true)
+	for i := 103; i >= 100; i-- {
+		if v := it.Next(); v == nil || v.(Number) != Number(i) {
+			t.Fatalf("expected %d, got %v", i, v)
+		}
+	}
+	if v := it.Next(); v != nil {
+		t.Fatalf("expected reverse iterator to stop at lower bound, got %v", v)
+	}
+}
+
+func TestSetCountPrefixString(t *testing.T) {
+	s := NewSet(String("a"), String("ab"), String("abc"), String("b"), String("ac"))
+	if got := s.CountPrefix(String("a")); got != 4 {
+		t.Fatalf("CountPrefix(a) = %d, want 4 (a, ab, abc, ac; not b)", got)
+	}
+	if got := s.CountPrefix(String("ab")); got != 2 {
+		t.Fatalf("CountPrefix(ab) = %d, want 2 (ab, abc)", got)
+	}
+	if got := s.CountPrefix(String("b")); got != 1 {
+		t.Fatalf("CountPrefix(b) = %d, want 1", got)
+	}
+}
+
+func TestSetNthInRange(t *testing.T) {
+	s := setOfNumbers(0, 9000)
+	if v := s.NthInRange(Number(100), Number(200), 5); v == nil || v.(Number) != Number(105) {
+		t.Fatalf("expected 105, got %v", v)
+	}
+	if v := s.NthInRange(Number(100), Number(103), 10); v != nil {
+		t.Fatalf("expected nil past end of range, got %v", v)
+	}
+}